@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	CHECKSUM_FOOTER = "-- sha256: %x\n"
+)
+
+// checksumWriter computes the SHA-256 checksum of the data written through it.
+type checksumWriter struct {
+	w    io.Writer
+	hash hash.Hash
+}
+
+func newChecksumWriter(w io.Writer) *checksumWriter {
+	return &checksumWriter{w, sha256.New()}
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.hash.Write(p[:n])
+	return n, err
+}
+
+// writeFooter writes the checksum of the data written so far as an SQL
+// comment. The footer itself is not included in the checksum.
+func (cw *checksumWriter) writeFooter() error {
+	_, err := fmt.Fprintf(cw.w, CHECKSUM_FOOTER, cw.hash.Sum(nil))
+	return err
+}
+
+// verifyDump checks the checksum in the footer of the dump file. Compressed
+// dump files are decompressed first.
+func verifyDump(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if codec := codecFromFilename(path); codec != "" {
+		dr, err := newDecompressReader(f, codec)
+		if err != nil {
+			return err
+		}
+		defer dr.Close()
+		r = dr
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	prefix := []byte(strings.SplitN(CHECKSUM_FOOTER, "%", 2)[0])
+	i := bytes.LastIndex(data, prefix)
+	if i == -1 || (i > 0 && data[i-1] != '\n') {
+		return fmt.Errorf("%s: checksum not found", path)
+	}
+
+	expected := strings.TrimSpace(string(data[i+len(prefix):]))
+	actual := fmt.Sprintf("%x", sha256.Sum256(data[:i]))
+	if expected != actual {
+		return fmt.Errorf("%s: checksum mismatch, expected %s, got %s", path, expected, actual)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cbroglie/mustache"
+	pg "gopkg.in/pg.v4"
+)
+
+const (
+	BEGIN_CLEANUP = `--
+-- PostgreSQL cleanup of the sampled data of database %s
+--
+
+BEGIN;
+
+`
+
+	END_CLEANUP = "\nCOMMIT;\n"
+
+	CLEANUP_DELETE_WHERE = "DELETE FROM %s WHERE %s;\n"
+
+	CLEANUP_DELETE_QUERY = "DELETE FROM %s WHERE (%s) IN (SELECT %s FROM (%s) sub)%s;\n"
+
+	CLEANUP_SKIPPED = "-- %s: %s, not deleted\n"
+)
+
+// cleanupStatement returns the statement deleting the rows of the table
+// matching what was dumped, or the reason the dumped rows cannot be selected
+// again, e.g. the sampled or limited rows. The tables dumped whole are deleted
+// rather than truncated, as TRUNCATE fails on the tables which are still
+// referenced by the foreign keys of the other tables. With --since only the
+// rows changed since the timestamp are deleted.
+func cleanupStatement(db *pg.DB, manifest *Manifest, opts *Options, iterator *ManifestIterator, v *ManifestItem) (string, string, error) {
+	if skipUnchanged(opts, v) {
+		return "", "the table is not dumped", nil
+	}
+	if v.Limit > 0 || v.SamplePercent > 0 || v.FollowReferences || len(v.Partitions) > 0 {
+		return "", "the dumped rows cannot be selected again", nil
+	}
+
+	filters := make([]string, 0)
+	if !opts.Since.IsZero() && v.UpdatedAtColumn != "" {
+		filters = append(filters, string(db.FormatQuery(nil, "(? >= ?)", pg.F(v.UpdatedAtColumn), opts.Since)))
+	}
+	if v.Query != "" || v.Where != "" || len(filters) > 0 {
+		// The conditions would be matched against the masked, hashed or
+		// shifted values loaded into the target database
+		item, err := withDefaults(iterator, &manifest.Defaults, v)
+		if err != nil {
+			return "", "", err
+		}
+		transformed, err := transformsColumns(item)
+		if err != nil {
+			return "", "", err
+		}
+		if transformed {
+			return "", "the dumped rows are transformed and cannot be selected again", nil
+		}
+	}
+
+	if v.Query != "" {
+		// The query selects from the source tables, which are not the
+		// tables of the target database if the table is renamed
+		if v.TargetTable != "" {
+			return "", "the dumped rows cannot be selected again", nil
+		}
+		pk, err := getTablePrimaryKey(db, v.Table)
+		if err != nil {
+			return "", "", err
+		}
+		if len(pk) == 0 {
+			return "", "the dumped rows cannot be selected again", nil
+		}
+		query, err := mustache.Render(v.Query, manifest.Vars)
+		if err != nil {
+			return "", "", err
+		}
+		stmt := fmt.Sprintf(CLEANUP_DELETE_QUERY, quoteTable(v.Target()), quoteColumns(pk), quoteColumns(pk), query, cleanupFilter(filters))
+		return stmt, "", nil
+	}
+
+	if v.Where != "" {
+		where, err := mustache.Render(v.Where, manifest.Vars)
+		if err != nil {
+			return "", "", err
+		}
+		filters = append([]string{fmt.Sprintf("(%s)", where)}, filters...)
+	}
+	if len(filters) > 0 {
+		return fmt.Sprintf(CLEANUP_DELETE_WHERE, quoteTable(v.Target()), strings.Join(filters, " AND ")), "", nil
+	}
+
+	return fmt.Sprintf(CLEAN_DELETE, quoteTable(v.Target())), "", nil
+}
+
+// cleanupFilter returns the conditions added to the primary key condition of
+// the DELETE statement.
+func cleanupFilter(filters []string) string {
+	if len(filters) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(filters, " AND ")
+}
+
+// transformsColumns returns true if any column of the table is dumped with a
+// value other than its own, i.e. masked, hashed, shifted, transformed or
+// replaced by a column expression.
+func transformsColumns(v *ManifestItem) (bool, error) {
+	if len(v.Masks) > 0 || len(v.Hash) > 0 || v.ShiftDays != nil || len(v.Transform) > 0 {
+		return true, nil
+	}
+	for _, col := range v.Columns {
+		_, expr, err := parseColumn(col)
+		if err != nil {
+			return false, fmt.Errorf("table %s: %v", v.Table, err)
+		}
+		if expr != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dumpCleanup dumps the script deleting the sampled data from the target
+// database, e.g. to tear down the fixtures. The tables are cleaned in the
+// reverse dependency order, so that the rows are deleted before the rows they
+// reference.
+func dumpCleanup(w io.Writer, db *pg.DB, manifest *Manifest, opts *Options, log *Logger) error {
+	tables := make([]ManifestItem, 0)
+	iterator := NewManifestIterator(db, manifest, opts.MaxDepth, log)
+	for {
+		v, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			break
+		}
+		if v.Refresh {
+			continue
+		}
+
+		// Only the tables can be cleaned, not the views
+		relkind, err := getRelkind(db, v.Table)
+		if err != nil {
+			return err
+		}
+		if relkind != RELKIND_TABLE && relkind != RELKIND_PARTITIONED {
+			continue
+		}
+		tables = append(tables, *v)
+	}
+
+	fmt.Fprintf(w, BEGIN_CLEANUP, commentText(opts.Database))
+	for i := len(tables) - 1; i >= 0; i-- {
+		stmt, skipped, err := cleanupStatement(db, manifest, opts, iterator, &tables[i])
+		if err != nil {
+			return fmt.Errorf("table %s: %v", tables[i].Table, err)
+		}
+		if skipped != "" {
+			log.Warningf("table %s: %s, not deleted by the cleanup", tables[i].Table, skipped)
+			stmt = fmt.Sprintf(CLEANUP_SKIPPED, commentText(tables[i].Target()), skipped)
+		}
+		fmt.Fprint(w, stmt)
+	}
+	_, err := fmt.Fprint(w, END_CLEANUP)
+	return err
+}
+
+// writeCleanup writes the cleanup script to the file.
+func writeCleanup(path string, db *pg.DB, manifest *Manifest, opts *Options, log *Logger) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = dumpCleanup(f, db, manifest, opts, log)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
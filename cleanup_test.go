@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanupStatement(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		v       ManifestItem
+		since   time.Time
+		want    string
+		skipped bool
+	}{
+		{
+			name: "whole table",
+			v:    ManifestItem{Table: "users"},
+			want: "DELETE FROM \"users\";\n",
+		},
+		{
+			name: "where",
+			v:    ManifestItem{Table: "users", Where: "id < {{max_id}}"},
+			want: "DELETE FROM \"users\" WHERE (id < 100);\n",
+		},
+		{
+			name: "renamed table",
+			v:    ManifestItem{Table: "users", TargetTable: "staging.users", Where: "id < 100"},
+			want: "DELETE FROM \"staging\".\"users\" WHERE (id < 100);\n",
+		},
+		{
+			name:    "limit",
+			v:       ManifestItem{Table: "users", Limit: 10},
+			skipped: true,
+		},
+		{
+			name: "masked table dumped whole",
+			v:    ManifestItem{Table: "users", Masks: map[string]string{"email": "'x'"}},
+			want: "DELETE FROM \"users\";\n",
+		},
+		{
+			name:    "where on a masked table",
+			v:       ManifestItem{Table: "users", Where: "email LIKE '%@example.com'", Masks: map[string]string{"email": "'x'"}},
+			skipped: true,
+		},
+		{
+			name:    "where on a hashed table",
+			v:       ManifestItem{Table: "users", Where: "id < 100", Hash: []string{"id"}},
+			skipped: true,
+		},
+		{
+			name:    "where on a shifted table",
+			v:       ManifestItem{Table: "users", Where: "created_at > now() - interval '1 year'", ShiftDays: &ShiftDays{Columns: []string{"created_at"}, Days: 30}},
+			skipped: true,
+		},
+		{
+			name:    "query on a transformed table",
+			v:       ManifestItem{Table: "users", Query: "SELECT * FROM users", Transform: map[string]string{"email": "tr a-z A-Z"}},
+			skipped: true,
+		},
+		{
+			name:    "where on a column expression",
+			v:       ManifestItem{Table: "users", Where: "id < 100", Columns: []string{"id", "lower(email) AS email"}},
+			skipped: true,
+		},
+		{
+			name:  "since",
+			v:     ManifestItem{Table: "users", UpdatedAtColumn: "updated_at"},
+			since: since,
+			want:  "DELETE FROM \"users\" WHERE (\"updated_at\" >= '2024-01-01 00:00:00+00:00');\n",
+		},
+		{
+			name:  "since and where",
+			v:     ManifestItem{Table: "users", Where: "id < 100", UpdatedAtColumn: "updated_at"},
+			since: since,
+			want:  "DELETE FROM \"users\" WHERE (id < 100) AND (\"updated_at\" >= '2024-01-01 00:00:00+00:00');\n",
+		},
+		{
+			name:  "since without updated_at_column",
+			v:     ManifestItem{Table: "users"},
+			since: since,
+			want:  "DELETE FROM \"users\";\n",
+		},
+		{
+			name:    "since on a masked table",
+			v:       ManifestItem{Table: "users", UpdatedAtColumn: "updated_at", Masks: map[string]string{"email": "'x'"}},
+			since:   since,
+			skipped: true,
+		},
+	}
+
+	manifest := &Manifest{Vars: map[string]string{"max_id": "100"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Since = tt.since
+			stmt, skipped, err := cleanupStatement(nil, manifest, opts, nil, &tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.skipped {
+				if skipped == "" {
+					t.Errorf("expected the table to be skipped, got %q", stmt)
+				}
+				return
+			}
+			if skipped != "" || stmt != tt.want {
+				t.Errorf("got %q (skipped: %q), want %q", stmt, skipped, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanupStatementSkipsUnchanged(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Since = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts.SinceSkipOthers = true
+	_, skipped, err := cleanupStatement(nil, &Manifest{}, opts, nil, &ManifestItem{Table: "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped == "" {
+		t.Error("expected the table without updated_at_column to be skipped")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	dsbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressSuffixes maps the suffixes of the file names to the codecs used for
+// them by default.
+var compressSuffixes = map[string]string{
+	".gz":  "gzip",
+	".zst": "zstd",
+	".bz2": "bzip2",
+}
+
+// codecFromFilename returns the codec of the file name suffix, or an empty
+// string if the file is not compressed.
+func codecFromFilename(path string) string {
+	for suffix, codec := range compressSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return codec
+		}
+	}
+	return ""
+}
+
+// newCompressWriter returns the writer compressing the data written to w
+// using the codec. The writer must be closed to flush the compressed data.
+func newCompressWriter(w io.Writer, codec string) (io.WriteCloser, error) {
+	switch codec {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "bzip2":
+		return dsbzip2.NewWriter(w, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %s", codec)
+}
+
+// newDecompressReader returns the reader decompressing r using the codec.
+// The reader must be closed once the data is read.
+func newDecompressReader(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case "bzip2":
+		return nopReadCloser{bzip2.NewReader(r)}, nil
+	}
+	return nil, fmt.Errorf("unknown compression %s", codec)
+}
+
+type nopReadCloser struct {
+	io.Reader
+}
+
+func (nopReadCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := strings.Repeat("COPY users (id, email) FROM stdin;\n1\tuser1@example.com\n\\.\n", 1000)
+	for _, codec := range []string{"gzip", "zstd", "bzip2"} {
+		t.Run(codec, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := newCompressWriter(&buf, codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.Len() == 0 || buf.Len() >= len(data) {
+				t.Errorf("unexpected size of the compressed data %d", buf.Len())
+			}
+
+			r, err := newDecompressReader(&buf, codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != data {
+				t.Errorf("the decompressed data differ from the original")
+			}
+		})
+	}
+}
+
+func TestCompressUnknownCodec(t *testing.T) {
+	if _, err := newCompressWriter(io.Discard, "lz4"); err == nil {
+		t.Error("expected an error for the unknown codec")
+	}
+}
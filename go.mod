@@ -1,9 +1,12 @@
 module pg_dump_sample
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/cbroglie/mustache v1.0.1
+	github.com/dsnet/compress v0.0.1
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/jinzhu/inflection v0.0.0-20180308033659-04140366298a // indirect
+	github.com/klauspost/compress v1.20.1
 	golang.org/x/crypto v0.0.0-20190228161510-8dd112bcdc25
 	gopkg.in/bsm/ratelimit.v1 v1.0.0-20160220154919-db14e161995a // indirect
 	gopkg.in/pg.v4 v4.9.5
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	pg "gopkg.in/pg.v4"
+)
+
+const (
+	BEGIN_GRAPH = "digraph dependencies {\n"
+
+	END_GRAPH = "}\n"
+
+	GRAPH_NODE = "  %s;\n"
+
+	GRAPH_NODE_DEPENDENCY = "  %s [style=dashed];\n"
+
+	GRAPH_EDGE = "  %s -> %s;\n"
+
+	GRAPH_EDGE_CYCLE = "  %s -> %s [color=red];\n"
+
+	TREE_NODE = "%s%s\n"
+
+	TREE_NODE_CYCLE = "%s%s (cycle)\n"
+
+	TREE_NODE_LISTED = "%s%s (see above)\n"
+)
+
+// DependencyGraph returns the foreign key dependencies of the tables as a
+// Graphviz DOT digraph. The edges point from the referencing table to the
+// referenced one. The tables which are not listed in the manifest are drawn
+// dashed and the edges forming cycles red.
+func DependencyGraph(db *pg.DB, manifest *Manifest) (string, error) {
+	// The dependencies are resolved the same way as for the dump, i.e.
+	// through the excluded tables
+	return dependencyGraph(NewManifestIterator(db, manifest, -1, nil))
+}
+
+// dependencyGraph returns the graph of the dependencies of the tables of the
+// iterator, which must not have been advanced yet. The tables are named and
+// their `depends_on` added as by the iterator.
+func dependencyGraph(iterator *ManifestIterator) (string, error) {
+	err := iterator.start()
+	if err != nil {
+		return "", err
+	}
+
+	tables := make([]string, 0)
+	deps := make(map[string][]string)
+	listed := make(map[string]bool)
+	for _, v := range iterator.manifest.Tables {
+		table, err := iterator.tableName(v.Table)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := deps[table]; !ok {
+			tables = append(tables, table)
+			deps[table] = nil
+		}
+		listed[table] = true
+	}
+
+	for i := 0; i < len(tables); i++ {
+		tableDeps, err := iterator.resolveDeps(tables[i])
+		if err != nil {
+			return "", err
+		}
+		deps[tables[i]] = tableDeps
+		for _, dep := range tableDeps {
+			if _, ok := deps[dep]; !ok {
+				tables = append(tables, dep)
+				deps[dep] = nil
+			}
+		}
+	}
+
+	component := stronglyConnected(tables, deps)
+
+	var buf bytes.Buffer
+	buf.WriteString(BEGIN_GRAPH)
+	for _, table := range tables {
+		if listed[table] {
+			fmt.Fprintf(&buf, GRAPH_NODE, dotQuote(table))
+		} else {
+			fmt.Fprintf(&buf, GRAPH_NODE_DEPENDENCY, dotQuote(table))
+		}
+	}
+	for _, table := range tables {
+		for _, dep := range deps[table] {
+			if component[table] == component[dep] {
+				fmt.Fprintf(&buf, GRAPH_EDGE_CYCLE, dotQuote(table), dotQuote(dep))
+			} else {
+				fmt.Fprintf(&buf, GRAPH_EDGE, dotQuote(table), dotQuote(dep))
+			}
+		}
+	}
+	buf.WriteString(END_GRAPH)
+
+	return buf.String(), nil
+}
+
+// DependencyTree returns the tables referenced by the foreign keys of the
+// table, directly and transitively, as an indented tree. The references back
+// to a table on the path are marked as cycles, the tables which are already
+// in the tree are not expanded again.
+func DependencyTree(db *pg.DB, table string) (string, error) {
+	var buf bytes.Buffer
+	listed := make(map[string]bool)
+
+	var visit func(table string, path []string) error
+	visit = func(table string, path []string) error {
+		indent := strings.Repeat("  ", len(path))
+		if contains(path, table) {
+			fmt.Fprintf(&buf, TREE_NODE_CYCLE, indent, table)
+			return nil
+		}
+		if listed[table] {
+			fmt.Fprintf(&buf, TREE_NODE_LISTED, indent, table)
+			return nil
+		}
+		fmt.Fprintf(&buf, TREE_NODE, indent, table)
+		listed[table] = true
+
+		deps, err := getTableDeps(db, table)
+		if err != nil {
+			return err
+		}
+		path = append(path, table)
+		visited := make(map[string]bool)
+		for _, dep := range deps {
+			// A table may reference another one using several foreign keys
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			err = visit(dep, path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := visit(table, make([]string, 0))
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// stronglyConnected returns the strongly connected component of every table
+// using Tarjan's algorithm. The tables are in a cycle if and only if they
+// belong to the same component. The self-references are not returned by
+// resolveDeps, so a table is never in a cycle on its own.
+func stronglyConnected(tables []string, deps map[string][]string) map[string]int {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	component := make(map[string]int)
+	next := 0
+
+	var visit func(table string)
+	visit = func(table string) {
+		index[table] = next
+		lowlink[table] = next
+		next++
+		stack = append(stack, table)
+		onStack[table] = true
+
+		for _, dep := range deps[table] {
+			if _, ok := index[dep]; !ok {
+				visit(dep)
+				if lowlink[dep] < lowlink[table] {
+					lowlink[table] = lowlink[dep]
+				}
+			} else if onStack[dep] && index[dep] < lowlink[table] {
+				lowlink[table] = index[dep]
+			}
+		}
+
+		if lowlink[table] == index[table] {
+			for {
+				n := len(stack) - 1
+				v := stack[n]
+				stack = stack[:n]
+				onStack[v] = false
+				component[v] = index[table]
+				if v == table {
+					break
+				}
+			}
+		}
+	}
+
+	for _, table := range tables {
+		if _, ok := index[table]; !ok {
+			visit(table)
+		}
+	}
+	return component
+}
+
+// dotQuote quotes the name as a DOT identifier.
+func dotQuote(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestDependencyGraph(t *testing.T) {
+	deps := searchPathDependencies{
+		StaticDependencies: StaticDependencies{
+			"payments": {"invoices"},
+			"invoices": {"customers"},
+		},
+		searchPath: []string{"billing"},
+	}
+	manifest := testManifest("billing.invoices", "payments", "invoices")
+	manifest.Tables[1].DependsOn = []string{"billing.audit"}
+
+	graph, err := dependencyGraph(NewManifestIteratorFrom(deps, manifest, -1, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph dependencies {
+  "invoices";
+  "payments";
+  "customers" [style=dashed];
+  "audit" [style=dashed];
+  "invoices" -> "customers";
+  "payments" -> "invoices";
+  "payments" -> "audit";
+}
+`
+	if graph != want {
+		t.Errorf("got\n%s\nwant\n%s", graph, want)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	pg "gopkg.in/pg.v4"
+	"gopkg.in/pg.v4/orm"
+)
+
+const (
+	BEGIN_TABLE_INSERT = `
+--
+-- Data for Name: %s; Type: TABLE DATA
+--
+
+`
+
+	INSERT_CMD_DUMP = "INSERT INTO %s (%s) VALUES\n\t%s%s;\n"
+
+	ON_CONFLICT_NOTHING = "\nON CONFLICT%s DO NOTHING"
+
+	ON_CONFLICT_UPDATE = "\nON CONFLICT (%s) DO UPDATE SET %s"
+)
+
+// insertWriter is an orm.Model writing the rows to the output as INSERT
+// statements as they are received from the database. Each row is expected to
+// have a single column containing the already quoted value tuple.
+type insertWriter struct {
+	w       io.Writer
+	table   string
+	columns []string
+	batch   int
+	rows    []string
+	row     string
+	// The ON CONFLICT clause of the statements
+	onConflict string
+	// The transforms of the columns, the rows have a column per value then
+	transforms []func([]byte) ([]byte, error)
+	values     []string
+}
+
+var _ orm.Model = (*insertWriter)(nil)
+
+func (iw *insertWriter) NewModel() orm.ColumnScanner {
+	return iw
+}
+
+func (iw *insertWriter) AddModel(_ orm.ColumnScanner) error {
+	if iw.transforms != nil {
+		iw.row = "(" + strings.Join(iw.values, ", ") + ")"
+		iw.values = iw.values[:0]
+	}
+	iw.rows = append(iw.rows, iw.row)
+	if len(iw.rows) >= iw.batch {
+		return iw.flush()
+	}
+	return nil
+}
+
+func (iw *insertWriter) ScanColumn(colIdx int, colName string, b []byte) error {
+	if iw.transforms == nil {
+		iw.row = string(b)
+		return nil
+	}
+
+	// The values which are not transformed are quoted already
+	transform := iw.transforms[colIdx]
+	if transform == nil {
+		iw.values = append(iw.values, string(b))
+		return nil
+	}
+	v, err := transform(b)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		iw.values = append(iw.values, "NULL")
+	} else {
+		iw.values = append(iw.values, quoteLiteral(string(v)))
+	}
+	return nil
+}
+
+func (iw *insertWriter) AfterQuery(_ orm.DB) error {
+	return iw.flush()
+}
+
+func (iw *insertWriter) AfterSelect(_ orm.DB) error {
+	return nil
+}
+
+func (iw *insertWriter) BeforeCreate(_ orm.DB) error {
+	return nil
+}
+
+func (iw *insertWriter) AfterCreate(_ orm.DB) error {
+	return nil
+}
+
+func (iw *insertWriter) flush() error {
+	if len(iw.rows) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(iw.w, INSERT_CMD_DUMP, quoteTable(iw.table), quoteColumns(iw.columns),
+		strings.Join(iw.rows, ",\n\t"), iw.onConflict)
+	iw.rows = iw.rows[:0]
+	return err
+}
+
+// onConflictClause returns the ON CONFLICT clause of the INSERT statements of
+// the table for the action, either "nothing", "update" or "error". The
+// conflicts are detected using the primary key of the table, the updates set
+// all the other columns.
+func onConflictClause(db *pg.DB, table string, columns []string, action string) (string, error) {
+	if action == "error" {
+		return "", nil
+	}
+
+	pk, err := getTablePrimaryKey(db, table)
+	if err != nil {
+		return "", err
+	}
+	if action == "nothing" {
+		if len(pk) == 0 {
+			// Any unique constraint
+			return fmt.Sprintf(ON_CONFLICT_NOTHING, ""), nil
+		}
+		return fmt.Sprintf(ON_CONFLICT_NOTHING, fmt.Sprintf(" (%s)", quoteColumns(pk))), nil
+	}
+
+	if len(pk) == 0 {
+		return "", fmt.Errorf("table %s: `--on-conflict=update` requires a primary key", table)
+	}
+	set := make([]string, 0)
+	for _, col := range columns {
+		if !contains(pk, col) {
+			set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", quoteIdent(col), quoteIdent(col)))
+		}
+	}
+	if len(set) == 0 {
+		// There is nothing to update
+		return fmt.Sprintf(ON_CONFLICT_NOTHING, fmt.Sprintf(" (%s)", quoteColumns(pk))), nil
+	}
+	return fmt.Sprintf(ON_CONFLICT_UPDATE, quoteColumns(pk), strings.Join(set, ", ")), nil
+}
+
+// dumpTableInserts dumps the rows returned from the source as INSERT
+// statements with up to batch rows per statement. The values are quoted by
+// the database server so that every data type is handled correctly, e.g. the
+// arrays and composite types are quoted as '{...}' and '(...)' literals
+// including their nested quotes, which are converted to the column types by
+// the INSERT. The values of the transformed columns are quoted after they are
+// transformed.
+func dumpTableInserts(w io.Writer, db orm.DB, table string, source string, columns []string, batch int, onConflict string, transforms []func([]byte) ([]byte, error)) (int, error) {
+	fmt.Fprintf(w, BEGIN_TABLE_INSERT, commentText(table))
+
+	values := make([]string, 0)
+	for i, col := range columns {
+		if transforms != nil && transforms[i] != nil {
+			values = append(values, fmt.Sprintf("%s::text", quoteIdent(col)))
+			continue
+		}
+		values = append(values, fmt.Sprintf("quote_nullable(%s)", quoteIdent(col)))
+	}
+	sql := fmt.Sprintf(`SELECT '(' || concat_ws(', ', %s) || ')' AS v FROM %s sub`,
+		strings.Join(values, ", "), source)
+	if transforms != nil {
+		// The tuple is built from the values of the row
+		sql = fmt.Sprintf(`SELECT %s FROM %s sub`, strings.Join(values, ", "), source)
+	}
+
+	iw := &insertWriter{
+		w:       w,
+		table:   table,
+		columns: columns,
+		batch:   batch,
+		rows:    make([]string, 0),
+
+		onConflict: onConflict,
+		transforms: transforms,
+		values:     make([]string, 0),
+	}
+	res, err := db.Query(iw, sql)
+	if err != nil {
+		return 0, &QueryError{Table: table, SQL: sql, Err: err}
+	}
+
+	return res.Affected(), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	pg "gopkg.in/pg.v4"
+)
+
+func TestDumpTableInsertsArraysAndComposites(t *testing.T) {
+	db, _ := testDB(t)
+	testExec(t, db,
+		"CREATE TYPE address AS (street text, lines text[])",
+		`CREATE TABLE items (
+			id int PRIMARY KEY,
+			nums int[],
+			tags text[],
+			addr address,
+			addrs address[]
+		)`,
+		`INSERT INTO items VALUES
+			(1, '{1,2,NULL}', '{"a b","c,d","e\"f","g''h","{i}",NULL,"NULL"}',
+				ROW('1 "Main" St, O''Hare', '{"x,y","(z)"}'), ARRAY[ROW('a\b', '{}')::address, NULL]),
+			(2, '{}', '{}', ROW(NULL, NULL), '{}'),
+			(3, NULL, NULL, NULL, NULL)`,
+		"CREATE TABLE items_copy (LIKE items)")
+
+	var buf bytes.Buffer
+	columns := []string{"id", "nums", "tags", "addr", "addrs"}
+	n, err := dumpTableInserts(&buf, db, "items_copy", "items", columns, 2, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d rows, want 3", n)
+	}
+
+	// The INSERT statements must restore the rows as they are
+	testExec(t, db, buf.String())
+	var diff int
+	_, err = db.QueryOne(pg.Scan(&diff), `SELECT count(*) FROM (
+		(TABLE items EXCEPT TABLE items_copy) UNION ALL (TABLE items_copy EXCEPT TABLE items)) d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != 0 {
+		t.Errorf("%d rows differ after restoring the INSERT statements:\n%s", diff, buf.String())
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/pg.v4/orm"
+)
+
+// jsonlWriter is an orm.Model writing the rows to the output as JSON lines as
+// they are received from the database. Each row is expected to have a single
+// column containing the JSON object of the row.
+type jsonlWriter struct {
+	w io.Writer
+}
+
+var _ orm.Model = (*jsonlWriter)(nil)
+
+func (jw *jsonlWriter) NewModel() orm.ColumnScanner {
+	return jw
+}
+
+func (jw *jsonlWriter) AddModel(_ orm.ColumnScanner) error {
+	return nil
+}
+
+func (jw *jsonlWriter) ScanColumn(colIdx int, colName string, b []byte) error {
+	if _, err := jw.w.Write(b); err != nil {
+		return err
+	}
+	_, err := io.WriteString(jw.w, "\n")
+	return err
+}
+
+func (jw *jsonlWriter) AfterQuery(_ orm.DB) error {
+	return nil
+}
+
+func (jw *jsonlWriter) AfterSelect(_ orm.DB) error {
+	return nil
+}
+
+func (jw *jsonlWriter) BeforeCreate(_ orm.DB) error {
+	return nil
+}
+
+func (jw *jsonlWriter) AfterCreate(_ orm.DB) error {
+	return nil
+}
+
+// dumpTableJSONL dumps the rows returned from the source as JSON objects, one
+// per line, mapping the column names to the values. The objects are built by
+// the database server: the NULL values are written as null, the numbers and
+// booleans as JSON numbers and booleans, and the timestamps as RFC3339 strings.
+// The time zone of the session must be UTC so that the offset of the
+// timestamps with time zone is +00:00, the timestamps without time zone have no
+// offset.
+func dumpTableJSONL(w io.Writer, db orm.DB, table string, source string) (int, error) {
+	sql := fmt.Sprintf(`SELECT row_to_json(sub) FROM %s sub`, source)
+	res, err := db.Query(&jsonlWriter{w: w}, sql)
+	if err != nil {
+		return 0, &QueryError{Table: table, SQL: sql, Err: err}
+	}
+
+	return res.Affected(), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	LOG_ERROR = iota
+	LOG_WARNING
+	LOG_INFO
+)
+
+// Logger writes the messages up to the configured level, e.g. to stderr. The
+// errors and warnings are always written.
+type Logger struct {
+	w     io.Writer
+	level int
+}
+
+func NewLogger(w io.Writer, verbose bool) *Logger {
+	level := LOG_WARNING
+	if verbose {
+		level = LOG_INFO
+	}
+	return &Logger{w, level}
+}
+
+func (l *Logger) logf(level int, prefix string, format string, args ...interface{}) {
+	if l == nil || level > l.level {
+		return
+	}
+	fmt.Fprintf(l.w, prefix+format+"\n", args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LOG_ERROR, "Error: ", format, args...)
+}
+
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.logf(LOG_WARNING, "Warning: ", format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LOG_INFO, "", format, args...)
+}
@@ -0,0 +1,728 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	pg "gopkg.in/pg.v4"
+)
+
+// testDB connects to the database of the PGDUMPSAMPLE_TEST_DATABASE URL, e.g.
+// postgres://postgres@localhost/postgres?sslmode=disable, with the search_path
+// set to a schema of the test, which is dropped once the test is done. The
+// tests using the database are skipped unless the URL is set.
+func testDB(t *testing.T) (*pg.DB, *Manifest) {
+	t.Helper()
+	url := os.Getenv("PGDUMPSAMPLE_TEST_DATABASE")
+	if url == "" {
+		t.Skip("PGDUMPSAMPLE_TEST_DATABASE is not set")
+	}
+	pgOpts, sslmode, err := parseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := "pg_dump_sample_" + regexp.MustCompile(`\W+`).ReplaceAllString(strings.ToLower(t.Name()), "_")
+	manifest := &Manifest{Schemas: []string{schema}, Tables: make([]ManifestItem, 0)}
+	pgOpts.Params = map[string]interface{}{"search_path": pg.Q(manifest.SearchPath())}
+	db, err := connectDBRetry(pgOpts, sslmode, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExec(t, db,
+		"DROP SCHEMA IF EXISTS "+quoteIdent(schema)+" CASCADE",
+		"CREATE SCHEMA "+quoteIdent(schema))
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA IF EXISTS " + quoteIdent(schema) + " CASCADE")
+		db.Close()
+	})
+	return db, manifest
+}
+
+// testExec runs the SQL commands, failing the test on the first error.
+func testExec(t *testing.T, db *pg.DB, cmds ...string) {
+	t.Helper()
+	for _, sql := range cmds {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+}
+
+// testManifest returns the manifest listing the tables in order.
+func testManifest(tables ...string) *Manifest {
+	manifest := &Manifest{Tables: make([]ManifestItem, 0)}
+	for _, table := range tables {
+		manifest.Tables = append(manifest.Tables, ManifestItem{Table: table})
+	}
+	return manifest
+}
+
+// orderedNames returns the names of the tables of the manifest in the order
+// they are returned by the iterator.
+func orderedNames(t *testing.T, deps DependencySource, manifest *Manifest) []string {
+	t.Helper()
+	tables, err := OrderTablesFrom(deps, manifest)
+	if err != nil {
+		t.Fatalf("OrderTablesFrom: %v", err)
+	}
+	names := make([]string, 0)
+	for _, v := range tables {
+		names = append(names, v.Table)
+	}
+	return names
+}
+
+func TestOrderTablesFrom(t *testing.T) {
+	tests := []struct {
+		name     string
+		deps     StaticDependencies
+		manifest *Manifest
+		want     []string
+	}{
+		{
+			name:     "no dependencies",
+			deps:     StaticDependencies{},
+			manifest: testManifest("a", "b", "c"),
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "chain",
+			deps:     StaticDependencies{"c": {"b"}, "b": {"a"}},
+			manifest: testManifest("c"),
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "chain listed in reverse",
+			deps:     StaticDependencies{"c": {"b"}, "b": {"a"}},
+			manifest: testManifest("c", "b", "a"),
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "diamond",
+			deps:     StaticDependencies{"d": {"b", "c"}, "b": {"a"}, "c": {"a"}},
+			manifest: testManifest("d"),
+			want:     []string{"a", "b", "c", "d"},
+		},
+		{
+			name:     "diamond listed in full",
+			deps:     StaticDependencies{"d": {"b", "c"}, "b": {"a"}, "c": {"a"}},
+			manifest: testManifest("c", "d", "b", "a"),
+			want:     []string{"a", "c", "b", "d"},
+		},
+		{
+			name:     "self-reference",
+			deps:     StaticDependencies{"a": {"a"}},
+			manifest: testManifest("a"),
+			want:     []string{"a"},
+		},
+		{
+			name:     "self-reference in a chain",
+			deps:     StaticDependencies{"b": {"a", "b"}, "a": {"a"}},
+			manifest: testManifest("b"),
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "table listed twice",
+			deps:     StaticDependencies{"b": {"a"}},
+			manifest: testManifest("b", "a", "b"),
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "dependency shared by the manifest tables",
+			deps:     StaticDependencies{"b": {"a"}, "c": {"a"}},
+			manifest: testManifest("b", "c"),
+			want:     []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := orderedNames(t, tt.deps, tt.manifest)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderTablesFromDiscovered(t *testing.T) {
+	deps := StaticDependencies{"orders": {"users"}}
+	manifest := testManifest("orders")
+	manifest.Tables[0].Where = "id < 100"
+
+	tables, err := OrderTablesFrom(deps, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ManifestItem{
+		{Table: "users"},
+		{Table: "orders", Where: "id < 100"},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("got %+v, want %+v", tables, want)
+	}
+}
+
+func TestManifestIteratorCycle(t *testing.T) {
+	deps := StaticDependencies{"a": {"b"}, "b": {"a"}}
+	iterator := NewManifestIteratorFrom(deps, testManifest("a"), -1, nil, nil)
+
+	tables := make([]ManifestItem, 0)
+	for {
+		v, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		tables = append(tables, *v)
+	}
+
+	// The reference from b back to a is ignored
+	want := []ManifestItem{
+		{Table: "b", CycleTargets: []string{"a"}},
+		{Table: "a"},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("got %+v, want %+v", tables, want)
+	}
+}
+
+func TestReadManifestBrokenYAML(t *testing.T) {
+	data := "tables:\n  - table: users\n   where: id < 100\n"
+	_, err := readManifest(strings.NewReader(data), "yaml")
+	if err == nil {
+		t.Fatal("expected an error for the broken YAML")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the line of the error, got %v", err)
+	}
+}
+
+func TestQuoteTable(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{`users`, `"users"`},
+		{`Users`, `"Users"`},
+		{`user`, `"user"`},
+		{`public.Users`, `"public"."Users"`},
+		{`My Schema.My Table`, `"My Schema"."My Table"`},
+		{`"a.b"."c.d"`, `"a.b"."c.d"`},
+		{`"say ""hi"""`, `"say ""hi"""`},
+	}
+	for _, tt := range tests {
+		if got := quoteTable(tt.name); got != tt.want {
+			t.Errorf("quoteTable(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildQueryQuotesTable(t *testing.T) {
+	v := &ManifestItem{Table: "Sales.Orders", Where: "id < 100"}
+	query, err := buildQuery(v, []string{"id", "Total"}, nil, nil, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT "id", "Total" FROM "Sales"."Orders" WHERE (id < 100)`
+	if query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	t.Setenv("PGDUMPSAMPLE_TEST_TENANT", "staging")
+
+	vars := map[string]string{
+		"braces":    "tenant_${PGDUMPSAMPLE_TEST_TENANT}",
+		"plain":     "$PGDUMPSAMPLE_TEST_TENANT",
+		"undefined": "x${PGDUMPSAMPLE_TEST_UNDEFINED}y",
+		"literal":   "no variables",
+	}
+	err := expandVars(vars, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"braces":    "tenant_staging",
+		"plain":     "staging",
+		"undefined": "xy",
+		"literal":   "no variables",
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("got %v, want %v", vars, want)
+	}
+}
+
+func TestExpandVarsStrict(t *testing.T) {
+	t.Setenv("PGDUMPSAMPLE_TEST_TENANT", "staging")
+
+	err := expandVars(map[string]string{"tenant": "${PGDUMPSAMPLE_TEST_TENANT}"}, true)
+	if err != nil {
+		t.Errorf("unexpected error for the defined variable: %v", err)
+	}
+
+	err = expandVars(map[string]string{"tenant": "${PGDUMPSAMPLE_TEST_UNDEFINED}"}, true)
+	if err == nil || !strings.Contains(err.Error(), "PGDUMPSAMPLE_TEST_UNDEFINED") {
+		t.Errorf("expected an error naming the undefined variable, got %v", err)
+	}
+}
+
+// searchPathDependencies names the tables of the schemas on the search_path
+// without the schema, like the database catalog does.
+type searchPathDependencies struct {
+	StaticDependencies
+	searchPath []string
+}
+
+func (s searchPathDependencies) TableName(table string) (string, error) {
+	for _, schema := range s.searchPath {
+		if strings.HasPrefix(table, schema+".") {
+			return strings.TrimPrefix(table, schema+"."), nil
+		}
+	}
+	return table, nil
+}
+
+func TestOrderTablesFromSchemaQualified(t *testing.T) {
+	deps := searchPathDependencies{
+		StaticDependencies: StaticDependencies{"payments": {"invoices"}},
+		searchPath:         []string{"billing"},
+	}
+	manifest := testManifest("payments", "billing.invoices")
+	manifest.Tables[1].Where = "paid"
+
+	tables, err := OrderTablesFrom(deps, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The manifest entry is used for the referenced table, which is not
+	// discovered again under the name of the foreign key
+	want := []ManifestItem{
+		{Table: "billing.invoices", Where: "paid"},
+		{Table: "payments"},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("got %+v, want %+v", tables, want)
+	}
+}
+
+func TestReadManifestYAMLAndJSON(t *testing.T) {
+	yamlData := `
+vars:
+  max_id: "100"
+exclude: [audit_*]
+tables:
+  - table: users
+    where: "id < {{max_id}}"
+    columns: [id, email]
+    masks:
+      email: "'user' || id || '@example.com'"
+  - table: orders
+    query: "SELECT * FROM orders WHERE user_id < {{max_id}}"
+    limit: 10
+    post_actions:
+      - "ANALYZE orders"
+`
+	jsonData := `{
+  "vars": {"max_id": "100"},
+  "exclude": ["audit_*"],
+  "tables": [
+    {
+      "table": "users",
+      "where": "id < {{max_id}}",
+      "columns": ["id", "email"],
+      "masks": {"email": "'user' || id || '@example.com'"}
+    },
+    {
+      "table": "orders",
+      "query": "SELECT * FROM orders WHERE user_id < {{max_id}}",
+      "limit": 10,
+      "post_actions": ["ANALYZE orders"]
+    }
+  ]
+}`
+
+	fromYAML, err := readManifest(strings.NewReader(yamlData), "yaml")
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	fromJSON, err := readManifest(strings.NewReader(jsonData), "json")
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("the manifests differ:\nyaml: %+v\njson: %+v", fromYAML, fromJSON)
+	}
+	if len(fromYAML.Tables) != 2 || fromYAML.Tables[1].Limit != 10 {
+		t.Errorf("unexpected tables %+v", fromYAML.Tables)
+	}
+}
+
+func TestReadManifestTOML(t *testing.T) {
+	yamlData := `
+vars:
+  max_id: "100"
+tables:
+  - table: users
+    where: "id < {{max_id}}"
+    columns: [id, email]
+    masks:
+      email: "'user' || id || '@example.com'"
+    shift_days:
+      columns: [created_at]
+      days: 30
+  - table: orders
+    query: |
+      SELECT *
+      FROM orders
+    limit: 10
+`
+	tomlData := `
+# Dates are valid TOML even if no manifest key takes one
+generated = 1979-05-27T07:32:00Z
+
+[vars]
+max_id = "100"
+
+[[tables]]
+table = "users"
+where = "id < {{max_id}}"
+columns = ["id", "email"]
+masks = { email = "'user' || id || '@example.com'" }
+shift_days = { columns = ["created_at"], days = 30 }
+
+[[tables]]
+table = "orders"
+query = """
+SELECT *
+FROM orders
+"""
+limit = 10
+`
+
+	fromYAML, err := readManifest(strings.NewReader(yamlData), "yaml")
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	fromTOML, err := readManifest(strings.NewReader(tomlData), "toml")
+	if err != nil {
+		t.Fatalf("toml: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromTOML) {
+		t.Errorf("the manifests differ:\nyaml: %+v\ntoml: %+v", fromYAML, fromTOML)
+	}
+}
+
+func TestReadManifestBrokenTOML(t *testing.T) {
+	_, err := readManifest(strings.NewReader("[[tables]]\ntable = \"users\nlimit = 10\n"), "toml")
+	if err == nil {
+		t.Fatal("expected an error for the broken TOML")
+	}
+}
+
+func TestBeforeActionsBeforeData(t *testing.T) {
+	db, manifest := testDB(t)
+	testExec(t, db,
+		"CREATE TABLE users (id int PRIMARY KEY)",
+		"INSERT INTO users SELECT generate_series(1, 3)")
+	manifest.Tables = append(manifest.Tables, ManifestItem{
+		Table:         "users",
+		BeforeActions: []string{"-- before {{table}}\nLOCK TABLE users"},
+		PostActions:   []string{"ANALYZE users"},
+	})
+
+	var buf bytes.Buffer
+	_, err := MakeDumpWithResult(context.Background(), db, manifest, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	before := strings.Index(out, "-- before users\nLOCK TABLE users;")
+	copyStart := strings.Index(out, "COPY \"users\"")
+	copyEnd := strings.Index(out, "\\.\n")
+	post := strings.Index(out, "ANALYZE users;")
+	if before < 0 || copyStart < 0 || copyEnd < 0 || post < 0 {
+		t.Fatalf("missing the actions or the data of the table:\n%s", out)
+	}
+	if !(before < copyStart && copyStart < copyEnd && copyEnd < post) {
+		t.Errorf("the before_actions must precede the COPY block and the post_actions follow it:\n%s", out)
+	}
+	if !strings.Contains(out[copyStart:copyEnd], "1\n2\n3\n") {
+		t.Errorf("unexpected data of the table:\n%s", out[copyStart:copyEnd])
+	}
+}
+
+func TestOrderedTables(t *testing.T) {
+	db, manifest := testDB(t)
+	testExec(t, db,
+		"CREATE TABLE countries (id int PRIMARY KEY)",
+		"CREATE TABLE users (id int PRIMARY KEY, country_id int REFERENCES countries)",
+		"CREATE TABLE orders (id int PRIMARY KEY, user_id int REFERENCES users, parent_id int REFERENCES orders)")
+	manifest.Tables = append(manifest.Tables,
+		ManifestItem{Table: "orders"},
+		ManifestItem{Table: "users", Where: "id < 100"})
+
+	tables, err := OrderedTables(db, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, v := range tables {
+		got = append(got, v.Table+" "+v.Where)
+	}
+	// The countries are discovered, the users keep their manifest entry
+	want := []string{"countries ", "users id < 100", "orders "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDumpTableAfterCopyError(t *testing.T) {
+	db, _ := testDB(t)
+	testExec(t, db,
+		"CREATE TABLE users (id int PRIMARY KEY)",
+		"INSERT INTO users SELECT generate_series(1, 3)")
+	opts := DefaultOptions()
+	ctx := context.Background()
+
+	// The division by zero fails the COPY once the first rows are sent
+	var buf bytes.Buffer
+	_, err := dumpTable(ctx, &buf, db, opts, "users", "(SELECT 1 / (id - 2) FROM users ORDER BY id)")
+	if _, ok := err.(*QueryError); !ok {
+		t.Fatalf("expected the query error of the COPY, got %v", err)
+	}
+
+	buf.Reset()
+	n, err := dumpTable(ctx, &buf, db, opts, "users", "(SELECT id FROM users ORDER BY id)")
+	if err != nil {
+		t.Fatalf("the table following the failed COPY: %v", err)
+	}
+	if n != 3 || buf.String() != "1\n2\n3\n" {
+		t.Errorf("got %d rows %q", n, buf.String())
+	}
+	if _, err := db.Exec("SELECT 1"); err != nil {
+		t.Errorf("the connections of the pool are broken: %v", err)
+	}
+}
+
+func TestDumpSqlCmd(t *testing.T) {
+	doBlock := "DO $$\nBEGIN\n  UPDATE users SET email = 'x;y';\n  PERFORM 1;\nEND\n$$"
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"ANALYZE users", "\nANALYZE users;\n"},
+		{"ANALYZE users;\n", "\nANALYZE users;\n"},
+		{doBlock, "\n" + doBlock + ";\n"},
+		{doBlock + ";", "\n" + doBlock + ";\n"},
+		{"DO $body$ BEGIN PERFORM '$$;'; END $body$;", "\nDO $body$ BEGIN PERFORM '$$;'; END $body$;\n"},
+		{"ANALYZE users -- the stats", "\nANALYZE users -- the stats\n;\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		dumpSqlCmd(&buf, tt.cmd)
+		if buf.String() != tt.want {
+			t.Errorf("dumpSqlCmd(%q) = %q, want %q", tt.cmd, buf.String(), tt.want)
+		}
+	}
+}
+
+// countingDependencies counts the lookups of every table.
+type countingDependencies struct {
+	StaticDependencies
+	names map[string]int
+	deps  map[string]int
+}
+
+func (c *countingDependencies) TableName(table string) (string, error) {
+	c.names[table]++
+	return c.StaticDependencies.TableName(table)
+}
+
+func (c *countingDependencies) TableDeps(table string) ([]string, error) {
+	c.deps[table]++
+	return c.StaticDependencies.TableDeps(table)
+}
+
+func TestManifestIteratorLooksUpOnce(t *testing.T) {
+	deps := &countingDependencies{
+		StaticDependencies: StaticDependencies{
+			"d": {"b", "c"},
+			"b": {"a"},
+			"c": {"a", "c"},
+			"e": {"a", "d"},
+		},
+		names: make(map[string]int),
+		deps:  make(map[string]int),
+	}
+	manifest := testManifest("e", "d", "c", "b", "d")
+	manifest.Tables[2].DependsOn = []string{"a"}
+
+	got := orderedNames(t, deps, manifest)
+	want := []string{"a", "b", "c", "d", "e"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, table := range want {
+		if deps.deps[table] != 1 {
+			t.Errorf("the dependencies of %s looked up %d times, want once", table, deps.deps[table])
+		}
+		if deps.names[table] > 1 {
+			t.Errorf("the name of %s looked up %d times, want at most once", table, deps.names[table])
+		}
+	}
+}
+
+func TestResolveTableNoColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		cols     []string
+		v        ManifestItem
+		defaults ManifestDefaults
+	}{
+		{
+			name: "all columns excluded",
+			cols: []string{"id", "email"},
+			v:    ManifestItem{Table: "users", ExcludeColumns: []string{"id", "email"}},
+		},
+		{
+			name:     "all columns excluded by the defaults",
+			cols:     []string{"api_token", "session_token"},
+			v:        ManifestItem{Table: "users"},
+			defaults: ManifestDefaults{ExcludeColumns: []string{"*_token"}},
+		},
+		{
+			name: "all columns dropped",
+			cols: []string{},
+			v:    ManifestItem{Table: "users"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := testManifest()
+			manifest.Defaults = tt.defaults
+			iterator := NewManifestIteratorFrom(StaticDependencies{}, manifest, -1, nil, nil)
+			iterator.colsCache["users"] = tt.cols
+
+			_, _, err := resolveTable(nil, manifest, DefaultOptions(), nil, iterator, &tt.v, nil)
+			if err == nil || !strings.Contains(err.Error(), "no columns to dump") {
+				t.Errorf("expected the error of the table without columns, got %v", err)
+			}
+		})
+	}
+}
+
+// copyData returns the COPY data of the table in the dump.
+func copyData(t *testing.T, out string, table string) string {
+	t.Helper()
+	start := strings.Index(out, "COPY "+quoteTable(table)+" ")
+	if start < 0 {
+		t.Fatalf("table %s not dumped:\n%s", table, out)
+	}
+	start += strings.Index(out[start:], "\n") + 1
+	return out[start : start+strings.Index(out[start:], "\\.\n")]
+}
+
+func TestFollowReferencesTableNames(t *testing.T) {
+	db, manifest := testDB(t)
+	schema := manifest.Schemas[0]
+	other := schema + "_other"
+	testExec(t, db,
+		"DROP SCHEMA IF EXISTS "+other+" CASCADE",
+		"CREATE SCHEMA "+other)
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA IF EXISTS " + other + " CASCADE")
+	})
+	testExec(t, db,
+		"CREATE TABLE accounts (id int PRIMARY KEY)",
+		`CREATE TABLE "Users" (id int PRIMARY KEY)`,
+		"CREATE TABLE "+other+".invoices (id int PRIMARY KEY)",
+		"INSERT INTO accounts SELECT generate_series(1, 5)",
+		`INSERT INTO "Users" SELECT generate_series(1, 5)`,
+		"INSERT INTO "+other+".invoices SELECT generate_series(1, 5)",
+		`CREATE TABLE items (
+			id int PRIMARY KEY,
+			account_id int REFERENCES accounts,
+			user_id int REFERENCES "Users",
+			invoice_id int REFERENCES `+other+`.invoices
+		)`,
+		"INSERT INTO items VALUES (1, 1, 1, 1), (2, 4, 1, 1), (3, 1, 4, 1), (4, 1, 1, 4)")
+
+	// The manifest names the parents unlike the catalog does
+	manifest.Tables = append(manifest.Tables,
+		ManifestItem{Table: schema + ".accounts", Where: "id < 3"},
+		ManifestItem{Table: "Users", Where: "id < 3"},
+		ManifestItem{Table: other + ".invoices", Where: "id < 3"},
+		ManifestItem{Table: "items", FollowReferences: true})
+
+	var buf bytes.Buffer
+	_, err := MakeDumpWithResult(context.Background(), db, manifest, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := copyData(t, buf.String(), "items"); got != "1\t1\t1\t1\n" {
+		t.Errorf("the items referencing the rows which were not dumped are dumped:\n%s", got)
+	}
+}
+
+func TestGetTableForeignKeysPartitions(t *testing.T) {
+	db, _ := testDB(t)
+	var version int
+	_, err := db.QueryOne(pg.Scan(&version), "SHOW server_version_num")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version < 110000 {
+		t.Skip("the foreign keys of the partitioned tables require PostgreSQL 11 or newer")
+	}
+	testExec(t, db,
+		"CREATE TABLE users (id int PRIMARY KEY)",
+		"CREATE TABLE products (id int PRIMARY KEY)",
+		`CREATE TABLE events (
+			id int,
+			created date,
+			user_id int REFERENCES users,
+			product_id int
+		) PARTITION BY RANGE (created)`,
+		`CREATE TABLE events_2024 PARTITION OF events
+			FOR VALUES FROM ('2024-01-01') TO ('2025-01-01') PARTITION BY RANGE (created)`,
+		`CREATE TABLE events_2024_h1 PARTITION OF events_2024
+			FOR VALUES FROM ('2024-01-01') TO ('2024-07-01')`,
+		`CREATE TABLE events_2024_h2 PARTITION OF events_2024
+			FOR VALUES FROM ('2024-07-01') TO ('2025-01-01')`,
+		// A foreign key of a single partition only
+		"ALTER TABLE events_2024_h2 ADD FOREIGN KEY (product_id) REFERENCES products")
+
+	fks, err := getTableForeignKeys(db, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, fk := range fks {
+		got = append(got, fk.Tablename+" "+strings.Join(fk.Columns, ","))
+	}
+	want := []string{"users user_id", "products product_id"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The filters of the partitioned table are not repeated either
+	dumped := map[string]string{"users": "SELECT * FROM users WHERE id < 10"}
+	filters, err := buildRefFilters(db, "events", dumped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 {
+		t.Errorf("got the filters %q, want the filter of users only", filters)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	pg "gopkg.in/pg.v4"
+)
+
+const (
+	// HMAC-SHA256 of the column value computed from the inner and outer
+	// padded keys, hex-encoded
+	HMAC_EXPR = `encode(sha256('\x%x'::bytea || sha256('\x%x'::bytea || convert_to(%s::text, 'UTF8'))), 'hex')`
+
+	// The first 63 bits of the hash as a non-negative bigint
+	HMAC_INT_EXPR = `(('x' || substr(%s, 1, 16))::bit(64)::bigint & 9223372036854775807)`
+
+	SHIFT_DAYS_EXPR = `(%s + (%s || ' days')::interval)::%s`
+
+	DEFAULT_SHIFT_MAX_DAYS = 365
+)
+
+// ShiftDays describes the shifting of the temporal columns of the table by
+// either a fixed number of days or by a number of days derived from the value
+// of another column.
+type ShiftDays struct {
+	Columns []string `yaml:"columns,flow" json:"columns" toml:"columns"`
+	Days    int      `yaml:"days" json:"days" toml:"days"`
+	By      string   `yaml:"by" json:"by" toml:"by"`
+	MaxDays int      `yaml:"max_days" json:"max_days" toml:"max_days"`
+}
+
+// isTemporal returns true if the dates of the type can be shifted.
+func isTemporal(typ ColumnType) bool {
+	switch typ.Typname {
+	case "date", "timestamp", "timestamptz":
+		return true
+	}
+	return false
+}
+
+type ColumnType struct {
+	Colname string
+	// The name of the type, e.g. int4
+	Typname string
+	// The SQL type including the modifiers, e.g. character varying(10)
+	Typedef string
+}
+
+func getTableColTypes(db *pg.DB, table string) (map[string]ColumnType, error) {
+	var model []ColumnType
+	sql := `
+		SELECT
+			a.attname AS colname,
+			t.typname AS typname,
+			format_type(a.atttypid, a.atttypmod) AS typedef
+		FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+		WHERE
+			a.attrelid = ?::regclass
+			AND a.attnum > 0
+			AND a.attisdropped = FALSE
+	`
+	_, err := db.Query(&model, sql, quoteTable(table))
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]ColumnType)
+	for _, v := range model {
+		types[v.Colname] = v
+	}
+	return types, nil
+}
+
+// hmacPads returns the inner and outer padded keys of HMAC-SHA256.
+func hmacPads(key string) ([]byte, []byte) {
+	k := []byte(key)
+	if len(k) > sha256.BlockSize {
+		sum := sha256.Sum256(k)
+		k = sum[:]
+	}
+
+	ipad := make([]byte, sha256.BlockSize)
+	opad := make([]byte, sha256.BlockSize)
+	copy(ipad, k)
+	copy(opad, k)
+	for i := range ipad {
+		ipad[i] ^= 0x36
+		opad[i] ^= 0x5c
+	}
+	return ipad, opad
+}
+
+// hmacExpr returns the SQL expression computing the hex-encoded HMAC-SHA256
+// of the column.
+func hmacExpr(col string, key string) string {
+	ipad, opad := hmacPads(key)
+	return fmt.Sprintf(HMAC_EXPR, opad, ipad, quoteIdent(col))
+}
+
+// hashExpr returns the SQL expression computing the keyed hash of the column
+// converted to the type of the column. The same values are always hashed to
+// the same result, so the hashed foreign keys still match the hashed keys
+// they reference.
+func hashExpr(col string, typ ColumnType, key string) string {
+	hash := hmacExpr(col, key)
+
+	switch typ.Typname {
+	case "int2":
+		return fmt.Sprintf("(%s %% 32768)::smallint", fmt.Sprintf(HMAC_INT_EXPR, hash))
+	case "int4":
+		return fmt.Sprintf("(%s %% 2147483648)::integer", fmt.Sprintf(HMAC_INT_EXPR, hash))
+	case "int8", "numeric":
+		return fmt.Sprintf("%s::%s", fmt.Sprintf(HMAC_INT_EXPR, hash), typ.Typedef)
+	case "uuid":
+		return fmt.Sprintf("substr(%s, 1, 32)::uuid", hash)
+	default:
+		// Casting to character types with a length truncates the hash
+		return fmt.Sprintf("%s::%s", hash, typ.Typedef)
+	}
+}
+
+// shiftDaysExpr returns the SQL expression shifting the column by the days.
+// The days derived from another column are in the range of -MaxDays to
+// MaxDays, the same for all the rows with the same value of the column.
+func shiftDaysExpr(col string, typ ColumnType, shift *ShiftDays, key string) string {
+	days := fmt.Sprintf("%d", shift.Days)
+	if shift.By != "" {
+		maxDays := shift.MaxDays
+		if maxDays == 0 {
+			maxDays = DEFAULT_SHIFT_MAX_DAYS
+		}
+		days = fmt.Sprintf("(%s %% %d - %d)",
+			fmt.Sprintf(HMAC_INT_EXPR, hmacExpr(shift.By, key)), 2*maxDays+1, maxDays)
+	}
+	return fmt.Sprintf(SHIFT_DAYS_EXPR, quoteIdent(col), days, typ.Typedef)
+}
+
+// tableMasks returns the masks of the table including the keyed hashes of the
+// hashed columns and the shifted temporal columns.
+func tableMasks(db *pg.DB, v *ManifestItem, key string) (map[string]string, error) {
+	if key == "" && (len(v.Hash) > 0 || v.ShiftDays != nil && v.ShiftDays.By != "") {
+		return nil, fmt.Errorf("table %s: `hash` and `shift_days` with `by` require `--mask-key`", v.Table)
+	}
+
+	types, err := getTableColTypes(db, v.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	masks := make(map[string]string)
+	for col, expr := range v.Masks {
+		masks[col] = expr
+	}
+	for _, col := range v.Hash {
+		typ, ok := types[col]
+		if !ok {
+			return nil, fmt.Errorf("table %s: hashed column %s not found", v.Table, col)
+		}
+		masks[col] = hashExpr(col, typ, key)
+	}
+
+	if v.ShiftDays != nil {
+		if _, ok := types[v.ShiftDays.By]; v.ShiftDays.By != "" && !ok {
+			return nil, fmt.Errorf("table %s: shift_days column %s not found", v.Table, v.ShiftDays.By)
+		}
+		for _, col := range v.ShiftDays.Columns {
+			typ, ok := types[col]
+			if !ok {
+				return nil, fmt.Errorf("table %s: shifted column %s not found", v.Table, col)
+			}
+			if !isTemporal(typ) {
+				return nil, fmt.Errorf("table %s: shifted column %s is not a date or timestamp", v.Table, col)
+			}
+			masks[col] = shiftDaysExpr(col, typ, v.ShiftDays, key)
+		}
+	}
+
+	return masks, nil
+}
+
+// matchColumn returns true if the column matches any of the names or patterns.
+func matchColumn(patterns []string, col string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, col); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMask returns the default mask of the column: the mask of the column
+// name if any, otherwise the mask of the first matching pattern in the sorted
+// order. The {{column}} in the mask is replaced by the quoted column name.
+func defaultMask(defaults *ManifestDefaults, col string) (string, bool) {
+	expr, ok := defaults.Masks[col]
+	if !ok {
+		patterns := make([]string, 0)
+		for pattern := range defaults.Masks {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, col); matched {
+				expr, ok = defaults.Masks[pattern], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	return strings.ReplaceAll(expr, "{{column}}", quoteIdent(col)), true
+}
+
+// withDefaults returns the table with the manifest defaults applied to its
+// columns. The columns excluded by default are dumped if the table lists its
+// columns, and the columns masked, hashed, shifted or transformed by the
+// table aren't masked or hashed by default. The masks take precedence over the
+// hashes.
+func withDefaults(iterator *ManifestIterator, defaults *ManifestDefaults, v *ManifestItem) (*ManifestItem, error) {
+	if len(defaults.ExcludeColumns) == 0 && len(defaults.Masks) == 0 && len(defaults.Hash) == 0 {
+		return v, nil
+	}
+
+	item := *v
+	cols := make([]string, 0)
+	if len(v.Columns) > 0 {
+		for _, col := range v.Columns {
+			name, expr, err := parseColumn(col)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %v", v.Table, err)
+			}
+			// The column expressions are dumped as they are
+			if expr == "" {
+				cols = append(cols, name)
+			}
+		}
+	} else {
+		tableCols, err := iterator.TableCols(v.Table)
+		if err != nil {
+			return nil, err
+		}
+		item.ExcludeColumns = append([]string{}, v.ExcludeColumns...)
+		for _, col := range excludeColumns(tableCols, v.ExcludeColumns) {
+			if matchColumn(defaults.ExcludeColumns, col) && !masksColumn(v, col) {
+				item.ExcludeColumns = append(item.ExcludeColumns, col)
+			} else {
+				cols = append(cols, col)
+			}
+		}
+	}
+
+	item.Masks = make(map[string]string)
+	for col, expr := range v.Masks {
+		item.Masks[col] = expr
+	}
+	item.Hash = append([]string{}, v.Hash...)
+	for _, col := range cols {
+		if masksColumn(v, col) {
+			continue
+		}
+		if expr, ok := defaultMask(defaults, col); ok {
+			item.Masks[col] = expr
+		} else if matchColumn(defaults.Hash, col) {
+			item.Hash = append(item.Hash, col)
+		}
+	}
+	return &item, nil
+}
+
+// masksColumn returns true if the table masks, hashes, shifts or transforms
+// the column itself.
+func masksColumn(v *ManifestItem, col string) bool {
+	if _, ok := v.Masks[col]; ok {
+		return true
+	}
+	if _, ok := v.Transform[col]; ok {
+		return true
+	}
+	if contains(v.Hash, col) {
+		return true
+	}
+	return v.ShiftDays != nil && contains(v.ShiftDays.Columns, col)
+}
+
+// validateDefaults checks the patterns of the manifest defaults.
+func validateDefaults(defaults *ManifestDefaults) error {
+	patterns := append(append([]string{}, defaults.ExcludeColumns...), defaults.Hash...)
+	for pattern := range defaults.Masks {
+		patterns = append(patterns, pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid defaults column pattern %s: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// mergeDefaults returns the defaults merged with the later defaults, which
+// take precedence in the masks.
+func mergeDefaults(defaults ManifestDefaults, later ManifestDefaults) ManifestDefaults {
+	merged := ManifestDefaults{
+		ExcludeColumns: append([]string{}, defaults.ExcludeColumns...),
+		Masks:          make(map[string]string),
+		Hash:           append([]string{}, defaults.Hash...),
+	}
+	for k, v := range defaults.Masks {
+		merged.Masks[k] = v
+	}
+	for k, v := range later.Masks {
+		merged.Masks[k] = v
+	}
+	for _, v := range later.ExcludeColumns {
+		if !contains(merged.ExcludeColumns, v) {
+			merged.ExcludeColumns = append(merged.ExcludeColumns, v)
+		}
+	}
+	for _, v := range later.Hash {
+		if !contains(merged.Hash, v) {
+			merged.Hash = append(merged.Hash, v)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestQueryErrorHidesHashKey(t *testing.T) {
+	key := "s3cret-key"
+	hash := hashExpr("email", ColumnType{Colname: "email", Typname: "text", Typedef: "text"}, key)
+	err := &QueryError{
+		Table: "users",
+		SQL:   fmt.Sprintf("COPY (SELECT %s AS email FROM users) TO STDOUT", hash),
+		Err:   errors.New("canceling statement due to statement timeout"),
+	}
+
+	msg := err.Error()
+	ipad, opad := hmacPads(key)
+	for _, secret := range []string{key, fmt.Sprintf("%x", ipad), fmt.Sprintf("%x", opad)} {
+		if strings.Contains(msg, secret) {
+			t.Errorf("the error reveals the key %s:\n%s", secret, msg)
+		}
+	}
+	if !strings.Contains(msg, "sha256('***'::bytea || sha256('***'::bytea || convert_to(\"email\"::text, 'UTF8')))") {
+		t.Errorf("unexpected redacted SQL:\n%s", msg)
+	}
+}
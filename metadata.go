@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cbroglie/mustache"
+	pg "gopkg.in/pg.v4"
+)
+
+const (
+	METADATA_SUFFIX = ".meta.json"
+
+	// The metadata file in the --split-output directory
+	SPLIT_METADATA_FILE = "_meta.json"
+)
+
+// DumpMetadata describes the dump, it is written to the metadata file next to
+// the dump.
+type DumpMetadata struct {
+	Version       string          `json:"version"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Database      string          `json:"database"`
+	ServerVersion string          `json:"server_version"`
+	Manifest      *Manifest       `json:"manifest"`
+	Tables        []TableMetadata `json:"tables"`
+}
+
+// TableMetadata describes a dumped table.
+type TableMetadata struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+	// The table is not listed in the manifest
+	Discovered bool `json:"discovered"`
+}
+
+// renderManifest returns a copy of the manifest with the vars substituted in
+// the queries and the actions, as they were used in the dump.
+func renderManifest(manifest *Manifest, result *DumpResult) (*Manifest, error) {
+	stats := make(map[string]TableStat)
+	for _, v := range result.Tables {
+		stats[v.Table] = v
+	}
+
+	render := func(list []string, vars map[string]string) ([]string, error) {
+		rendered := make([]string, 0)
+		for _, v := range list {
+			s, err := mustache.Render(v, vars)
+			if err != nil {
+				return nil, err
+			}
+			rendered = append(rendered, s)
+		}
+		return rendered, nil
+	}
+
+	m := *manifest
+	var err error
+	m.PreActions, err = render(manifest.PreActions, manifest.Vars)
+	if err != nil {
+		return nil, err
+	}
+	m.PostActions, err = render(manifest.PostActions, manifest.Vars)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Tables = make([]ManifestItem, 0)
+	for _, v := range manifest.Tables {
+		fields, err := render([]string{v.Query, v.Where, v.OrderBy}, manifest.Vars)
+		if err != nil {
+			return nil, err
+		}
+		v.Query, v.Where, v.OrderBy = fields[0], fields[1], fields[2]
+
+		stat := stats[v.Table]
+		vars := tableVars(manifest.Vars, &v, stat.Columns)
+		v.BeforeActions, err = render(v.BeforeActions, vars)
+		if err != nil {
+			return nil, err
+		}
+		vars["row_count"] = strconv.Itoa(stat.Rows)
+		v.PostActions, err = render(v.PostActions, vars)
+		if err != nil {
+			return nil, err
+		}
+		m.Tables = append(m.Tables, v)
+	}
+
+	return &m, nil
+}
+
+// metadataPath returns the path of the metadata file of the dump output.
+func metadataPath(opts *Options) string {
+	if opts.SplitOutput != "" {
+		return filepath.Join(opts.SplitOutput, SPLIT_METADATA_FILE)
+	}
+	return opts.OutputFile + METADATA_SUFFIX
+}
+
+// writeMetadata writes the metadata of the dump to the file.
+func writeMetadata(path string, db *pg.DB, manifest *Manifest, result *DumpResult, start time.Time) error {
+	metadata := DumpMetadata{
+		Version:   VERSION,
+		Timestamp: start.UTC(),
+		Tables:    make([]TableMetadata, 0),
+	}
+
+	_, err := db.QueryOne(pg.Scan(&metadata.Database), "SELECT current_database()")
+	if err != nil {
+		return err
+	}
+	_, err = db.QueryOne(pg.Scan(&metadata.ServerVersion), "SHOW server_version")
+	if err != nil {
+		return err
+	}
+
+	metadata.Manifest, err = renderManifest(manifest, result)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range result.Tables {
+		metadata.Tables = append(metadata.Tables, TableMetadata{
+			Table:      v.Table,
+			Rows:       v.Rows,
+			Discovered: v.Discovered,
+		})
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	INCLUDE_TABLE_DUMP = "\\ir %s\n"
+
+	SPLIT_INDEX_FILE = "_all.sql"
+)
+
+// TableWriterFunc returns the writer for the data of the table. The writer is
+// closed once the table is dumped.
+type TableWriterFunc func(table string) (io.WriteCloser, error)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// SingleWriter returns a TableWriterFunc writing all the tables to w.
+func SingleWriter(w io.Writer) TableWriterFunc {
+	return func(table string) (io.WriteCloser, error) {
+		return nopCloser{w}, nil
+	}
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// tableFilename returns a file name for the table which is safe to use on
+// any filesystem.
+func tableFilename(table string, ext string) string {
+	schema, name := parseTableName(table)
+	if schema != "" {
+		name = schema + "." + name
+	}
+	return unsafeFilenameChars.ReplaceAllString(name, "_") + ext
+}
+
+// SplitWriter returns a TableWriterFunc writing every table to its own file
+// with the extension in the directory. The files are included in the index in
+// the order they are created, so that the index can be loaded as a whole using
+// psql(1). The index is optional.
+func SplitWriter(dir string, ext string, index io.Writer) TableWriterFunc {
+	used := map[string]bool{SPLIT_INDEX_FILE: true}
+	return func(table string) (io.WriteCloser, error) {
+		base := tableFilename(table, "")
+		filename := base + ext
+		for i := 2; used[filename]; i++ {
+			filename = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+		used[filename] = true
+
+		f, err := os.Create(filepath.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		if index != nil {
+			fmt.Fprintf(index, INCLUDE_TABLE_DUMP, filename)
+		}
+		return f, nil
+	}
+}
+
+// tempFile is the file written under a temporary name in the directory of the
+// final file, so that the final file is never seen incomplete.
+type tempFile struct {
+	*os.File
+	path string
+}
+
+// createTempFile creates the temporary file of the file at path.
+func createTempFile(path string) (*tempFile, error) {
+	dir, base := filepath.Split(path)
+	tmp := filepath.Join(dir, fmt.Sprintf(".%s.%d.tmp", base, os.Getpid()))
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &tempFile{f, path}, nil
+}
+
+// Commit closes the temporary file and renames it to the final file.
+func (f *tempFile) Commit() error {
+	err := f.File.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	err = os.Rename(f.Name(), f.path)
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Abort closes and removes the temporary file, the final file is left as is.
+func (f *tempFile) Abort() {
+	f.File.Close()
+	os.Remove(f.Name())
+}
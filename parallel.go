@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	pg "gopkg.in/pg.v4"
+)
+
+type dumpTask struct {
+	item   *ManifestItem
+	cols   []string
+	source string
+	buf    bytes.Buffer
+	stats  TableStat
+	err    error
+	done   chan struct{}
+}
+
+// dumpTablesParallel dumps the data of up to opts.Jobs tables concurrently,
+// each using its own connection from the pool. The output of each table is
+// buffered and written in the dependency order once all the preceding tables
+// are written.
+func dumpTablesParallel(ctx context.Context, db *pg.DB, manifest *Manifest, opts *Options, log *Logger, tw TableWriterFunc) ([]TableStat, error) {
+	// Resolve the tables first, the references are followed using the
+	// queries of the already resolved tables
+	tasks := make([]*dumpTask, 0)
+	failed := make(TableErrors, 0)
+	dumped := make(map[string]string)
+	truncated := make(map[string]bool)
+	iterator := NewManifestIterator(db, manifest, opts.MaxDepth, log)
+	for {
+		v, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			break
+		}
+		if v.Refresh {
+			continue
+		}
+		if skipUnchanged(opts, v) {
+			log.Infof("Skipping table %s, it has no `updated_at_column`", v.Table)
+			continue
+		}
+		if opts.TruncateEach {
+			err = setTruncate(db, v, truncated)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		cols, source, err := resolveTable(db, manifest, opts, log, iterator, v, dumped)
+		if err == nil && opts.SkipUnreadable {
+			err = checkReadable(db, source)
+			if isPermissionDenied(err) {
+				log.Warningf("Skipping table %s, it can't be read: %v", v.Table, err)
+				forgetDumped(iterator, dumped, v.Table)
+				continue
+			}
+		}
+		if err != nil {
+			if !opts.ContinueOnError {
+				return nil, err
+			}
+			log.Errorf("Failed to dump table %s: %v", v.Table, err)
+			failed = append(failed, fmt.Errorf("table %s: %v", v.Table, err))
+			continue
+		}
+
+		tasks = append(tasks, &dumpTask{
+			item:   v,
+			cols:   cols,
+			source: source,
+			done:   make(chan struct{}),
+		})
+	}
+
+	// Once the dump is aborted, the running tables are cancelled and the
+	// workers are waited for, so that they don't hold the connections
+	ctx, cancel := context.WithCancel(ctx)
+	var workers sync.WaitGroup
+	defer func() {
+		cancel()
+		workers.Wait()
+	}()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		sem := make(chan struct{}, opts.Jobs)
+		for i, t := range tasks {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				// The remaining tables are never started
+				for _, t := range tasks[i:] {
+					t.err = ctx.Err()
+					close(t.done)
+				}
+				return
+			}
+
+			workers.Add(1)
+			go func(t *dumpTask) {
+				defer func() {
+					<-sem
+					close(t.done)
+					workers.Done()
+				}()
+
+				log.Infof("Dumping table %s", t.item.Table)
+				start := time.Now()
+
+				rows, err := dumpTableData(ctx, &t.buf, db, opts, t.item, t.cols, t.source)
+				if err != nil {
+					t.err = err
+					return
+				}
+
+				elapsed := time.Since(start)
+				size := int64(t.buf.Len())
+				log.Infof("Dumped table %s: %s", t.item.Table, throughput(rows, size, elapsed))
+				t.stats = TableStat{Table: t.item.Table, Columns: t.cols, Rows: rows, Bytes: size, Duration: elapsed}
+			}(t)
+		}
+	}()
+
+	stats := make([]TableStat, 0)
+	for _, t := range tasks {
+		<-t.done
+		if opts.SkipUnreadable && isPermissionDenied(t.err) {
+			// E.g. the column privileges or the row security policies
+			// fail the COPY only
+			log.Warningf("Skipping table %s, it can't be read: %v", t.item.Table, t.err)
+			continue
+		}
+		if t.err != nil {
+			if !opts.ContinueOnError {
+				if isPermissionDenied(t.err) {
+					return nil, tableError(t.item.Table, t.err)
+				}
+				return nil, t.err
+			}
+			// Nothing was written for the table yet, it can be skipped
+			log.Errorf("Failed to dump table %s: %v", t.item.Table, t.err)
+			failed = append(failed, tableError(t.item.Table, t.err))
+			continue
+		}
+
+		w, err := tw(t.item.Table)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.Savepoints && writesSQL(opts) {
+			fmt.Fprintf(w, BEGIN_SAVEPOINT, savepointName(t.item))
+		}
+
+		if writesSQL(opts) && t.item.IncludeSchema {
+			err = dumpTableSchema(w, db, t.item.Table, t.item.Target(), t.cols)
+			if err != nil {
+				w.Close()
+				return nil, err
+			}
+		}
+
+		vars := tableVars(manifest.Vars, t.item, t.cols)
+		if writesSQL(opts) {
+			err = dumpSqlCmds(w, t.item.BeforeActions, vars)
+			if err != nil {
+				w.Close()
+				return nil, err
+			}
+		}
+
+		_, err = t.buf.WriteTo(w)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		stats = append(stats, t.stats)
+
+		if writesSQL(opts) {
+			vars["row_count"] = strconv.Itoa(t.stats.Rows)
+			err = dumpSqlCmds(w, t.item.PostActions, vars)
+			if err != nil {
+				w.Close()
+				return nil, err
+			}
+		}
+
+		if opts.Savepoints && writesSQL(opts) {
+			fmt.Fprintf(w, RELEASE_SAVEPOINT, savepointName(t.item))
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(failed) > 0 {
+		return stats, failed
+	}
+	return stats, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	pg "gopkg.in/pg.v4"
+)
+
+func TestDumpTablesParallelSkipsUnreadableCopy(t *testing.T) {
+	db, manifest := testDB(t)
+	schema := manifest.Schemas[0]
+	role := schema + "_reader"
+	_, err := db.Exec("CREATE ROLE " + role + " NOLOGIN")
+	if err != nil {
+		t.Skipf("cannot create the role of the test: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP OWNED BY " + role)
+		db.Exec("DROP ROLE " + role)
+	})
+	testExec(t, db,
+		"CREATE TABLE users (id int PRIMARY KEY, secret text)",
+		"CREATE TABLE orders (id int PRIMARY KEY)",
+		"INSERT INTO users VALUES (1, 'x')",
+		"INSERT INTO orders VALUES (1)",
+		"GRANT USAGE ON SCHEMA "+schema+" TO "+role,
+		// The table can be selected from, but not all of its columns
+		"GRANT SELECT (id) ON users TO "+role,
+		"GRANT SELECT ON orders TO "+role)
+
+	// Every connection of the dump, including the ones of the COPY, runs
+	// as the role
+	pgOpts := *db.Options()
+	pgOpts.Params = map[string]interface{}{"role": role}
+	for k, v := range db.Options().Params {
+		pgOpts.Params[k] = v
+	}
+	readerDB := pg.Connect(&pgOpts)
+	defer readerDB.Close()
+
+	manifest.Tables = append(manifest.Tables, ManifestItem{Table: "users"}, ManifestItem{Table: "orders"})
+	opts := DefaultOptions()
+	opts.Jobs = 2
+	opts.SkipUnreadable = true
+
+	var buf bytes.Buffer
+	result, err := MakeDumpWithOptions(context.Background(), readerDB, manifest, opts, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tables) != 1 || result.Tables[0].Table != "orders" {
+		t.Errorf("got the tables %+v, want orders only", result.Tables)
+	}
+	if strings.Contains(buf.String(), `COPY "users"`) {
+		t.Errorf("the unreadable table is dumped:\n%s", buf.String())
+	}
+}
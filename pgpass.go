@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pgpassFile returns the path to the password file, either from $PGPASSFILE
+// or ~/.pgpass.
+func pgpassFile() string {
+	if path := os.Getenv("PGPASSFILE"); path != "" {
+		return path
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(currentUser.HomeDir, ".pgpass")
+}
+
+// splitPgpassLine splits the line of the password file into fields. The `:`
+// and `\` characters can be escaped by `\`.
+func splitPgpassLine(line string) []string {
+	fields := make([]string, 0)
+	field := ""
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			field += string(line[i+1])
+			i++
+		case c == ':':
+			fields = append(fields, field)
+			field = ""
+		default:
+			field += string(c)
+		}
+	}
+	return append(fields, field)
+}
+
+// lookupPgpass returns the password matching the connection parameters from
+// the password file, the same way as libpq does. The file is ignored if its
+// permissions allow access to group or others.
+func lookupPgpass(host string, port int, database string, username string, log *Logger) (string, error) {
+	path := pgpassFile()
+	if path == "" {
+		return "", nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		log.Warningf("password file %s has group or world access; permissions should be u=rw (0600) or less", path)
+		return "", nil
+	}
+
+	// Unix-domain socket connections are matched by localhost
+	if host == "" || strings.HasPrefix(host, "/") {
+		host = "localhost"
+	}
+	values := []string{host, strconv.Itoa(port), database, username}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := splitPgpassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+
+		match := true
+		for i, v := range values {
+			if fields[i] != "*" && fields[i] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return fields[4], nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// readPasswordFile returns the first line of the file as the password. The
+// file is ignored if anyone can read it, then the password is empty.
+func readPasswordFile(path string, log *Logger) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		log.Warningf("password file %s is world-readable, ignoring it; permissions should be u=rw (0600) or less", path)
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.SplitN(string(data), "\n", 2)[0]
+	return strings.TrimRight(line, "\r"), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	pg "gopkg.in/pg.v4"
+)
+
+const (
+	PROGRESS_WIDTH = 30
+
+	PROGRESS_INTERVAL = 100 * time.Millisecond
+
+	// Return to the start of the line and clear it
+	PROGRESS_CLEAR = "\r\033[K"
+)
+
+// progressWriter counts the rows written through it, i.e. the lines of the
+// COPY data or the value tuples of the INSERT statements, and draws the
+// progress of the table to the terminal.
+type progressWriter struct {
+	w        io.Writer
+	term     io.Writer
+	table    string
+	estimate int64
+	rows     int64
+	drawn    time.Time
+	// The separator preceding or following every row
+	sep []byte
+}
+
+func newProgressWriter(w io.Writer, term io.Writer, table string, estimate int64) *progressWriter {
+	return &progressWriter{w: w, term: term, table: table, estimate: estimate, sep: []byte("\n")}
+}
+
+// countInserts makes the writer count the value tuples of the INSERT
+// statements, every tuple starts on a line of its own.
+func (pw *progressWriter) countInserts() {
+	pw.sep = []byte("\n\t(")
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.rows += int64(bytes.Count(p[:n], pw.sep))
+	if time.Since(pw.drawn) >= PROGRESS_INTERVAL {
+		pw.draw()
+	}
+	return n, err
+}
+
+func (pw *progressWriter) draw() {
+	pw.drawn = time.Now()
+	if pw.estimate <= 0 {
+		fmt.Fprintf(pw.term, "%s%s: %d rows", PROGRESS_CLEAR, pw.table, pw.rows)
+		return
+	}
+
+	// The estimate may be outdated or the rows sampled
+	done := pw.rows
+	if done > pw.estimate {
+		done = pw.estimate
+	}
+	filled := int(done * PROGRESS_WIDTH / pw.estimate)
+	fmt.Fprintf(pw.term, "%s%s: [%s%s] %3d%% %d/~%d rows", PROGRESS_CLEAR, pw.table,
+		strings.Repeat("=", filled), strings.Repeat(" ", PROGRESS_WIDTH-filled),
+		done*100/pw.estimate, pw.rows, pw.estimate)
+}
+
+// clear removes the progress from the terminal.
+func (pw *progressWriter) clear() {
+	fmt.Fprint(pw.term, PROGRESS_CLEAR)
+}
+
+// getTableEstimate returns the planner's estimate of the number of rows of
+// the table including its partitions, zero if unknown.
+func getTableEstimate(db *pg.DB, table string) (int64, error) {
+	var estimate int64
+	sql := `
+		WITH RECURSIVE t AS (
+			SELECT c.oid, c.relkind, c.reltuples
+			FROM pg_catalog.pg_class c
+			WHERE c.oid = ?::regclass
+			UNION ALL
+			SELECT c.oid, c.relkind, c.reltuples
+			FROM t
+			JOIN pg_catalog.pg_inherits i ON i.inhparent = t.oid
+			JOIN pg_catalog.pg_class c ON c.oid = i.inhrelid
+			WHERE t.relkind = 'p'
+		)
+		SELECT COALESCE(SUM(GREATEST(reltuples, 0)), 0)::bigint FROM t
+	`
+	_, err := db.QueryOne(pg.Scan(&estimate), sql, quoteTable(table))
+	if err != nil {
+		return 0, err
+	}
+	return estimate, nil
+}
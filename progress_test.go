@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProgressWriterCopy(t *testing.T) {
+	var out, term bytes.Buffer
+	pw := newProgressWriter(&out, &term, "users", 10)
+	io.WriteString(pw, "1\tuser1@example.com\n2\tuser2@example.com\n")
+	io.WriteString(pw, "3\tuser3@example.com\n")
+	if pw.rows != 3 {
+		t.Errorf("got %d rows, want 3", pw.rows)
+	}
+	if !strings.Contains(term.String(), "users: [") {
+		t.Errorf("the progress is not drawn: %q", term.String())
+	}
+}
+
+func TestProgressWriterInserts(t *testing.T) {
+	var out, term bytes.Buffer
+	pw := newProgressWriter(&out, &term, "users", 10)
+	pw.countInserts()
+
+	iw := &insertWriter{
+		w:       pw,
+		table:   "users",
+		columns: []string{"id", "bio"},
+		batch:   2,
+		rows:    make([]string, 0),
+	}
+	for _, row := range []string{"(1, 'a\nb')", "(2, NULL)", "(3, 'c')"} {
+		iw.ScanColumn(0, "v", []byte(row))
+		if err := iw.AddModel(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iw.AfterQuery(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if pw.rows != 3 {
+		t.Errorf("got %d rows, want 3:\n%s", pw.rows, out.String())
+	}
+}
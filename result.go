@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	pg "gopkg.in/pg.v4"
+)
+
+// DumpResult holds the statistics of the whole dump.
+type DumpResult struct {
+	Tables   []TableStat
+	Bytes    int64
+	Duration time.Duration
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count *int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.count += int64(n)
+	return n, err
+}
+
+type countingWriteCloser struct {
+	countingWriter
+	c io.Closer
+}
+
+func (cw countingWriteCloser) Close() error {
+	return cw.c.Close()
+}
+
+// DefaultOptions returns the options of the dump the command-line uses by
+// default, i.e. the data of the tables in the COPY format in a single
+// transaction.
+func DefaultOptions() *Options {
+	return &Options{
+		Encoding:      "UTF8",
+		Format:        "copy",
+		CopyFormat:    "text",
+		RowsPerInsert: 1,
+		OnConflict:    "error",
+		MaxDepth:      -1,
+		Jobs:          1,
+		Seed:          -1,
+	}
+}
+
+// MakeDumpWithResult makes the dump to w with the default options and returns
+// its statistics. The context is checked before dumping each table, the COPY
+// of the table being dumped is cancelled on the server.
+func MakeDumpWithResult(ctx context.Context, db *pg.DB, manifest *Manifest, w io.Writer) (*DumpResult, error) {
+	return MakeDumpWithOptions(ctx, db, manifest, DefaultOptions(), w)
+}
+
+// MakeDumpWithOptions makes the dump like MakeDumpWithResult with the options,
+// e.g. DefaultOptions with the format changed.
+func MakeDumpWithOptions(ctx context.Context, db *pg.DB, manifest *Manifest, opts *Options, w io.Writer) (*DumpResult, error) {
+	return makeDumpResult(ctx, db, manifest, opts, nil, w, SingleWriter(w))
+}
+
+func makeDumpResult(ctx context.Context, db *pg.DB, manifest *Manifest, opts *Options, log *Logger, w io.Writer, tw TableWriterFunc) (*DumpResult, error) {
+	start := time.Now()
+	result := DumpResult{}
+
+	// Count the bytes written both to w and to the table writers
+	cw := countingWriter{w, &result.Bytes}
+	ctw := func(table string) (io.WriteCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tableWriter, err := tw(table)
+		if err != nil {
+			return nil, err
+		}
+		return countingWriteCloser{countingWriter{tableWriter, &result.Bytes}, tableWriter}, nil
+	}
+
+	stats, err := makeDumpStats(ctx, db, manifest, opts, log, cw, ctw)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if _, ok := err.(TableErrors); err != nil && !ok {
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+	for _, v := range manifest.Tables {
+		listed[v.Table] = true
+	}
+	for i := range stats {
+		stats[i].Discovered = !listed[stats[i].Table]
+	}
+
+	result.Tables = stats
+	result.Duration = time.Since(start)
+	return &result, err
+}
+
+// formatCount formats the number in the human-readable form, e.g. 1.2M.
+func formatCount(n float64) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fk", n/1e3)
+	}
+	return fmt.Sprintf("%.0f", n)
+}
+
+// formatBytes formats the size in the human-readable form, e.g. 340 MB.
+func formatBytes(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1f GB", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f kB", n/1e3)
+	}
+	return fmt.Sprintf("%.0f B", n)
+}
+
+// throughput describes the size of the table data and the speed it was
+// dumped at, e.g. "1.2M rows, 340 MB in 8.1s (42.0 MB/s, 148.1k rows/s)".
+func throughput(rows int, bytes int64, elapsed time.Duration) string {
+	s := fmt.Sprintf("%s rows, %s in %v", formatCount(float64(rows)), formatBytes(float64(bytes)),
+		elapsed.Round(time.Millisecond))
+	if secs := elapsed.Seconds(); secs > 0 {
+		s += fmt.Sprintf(" (%s/s, %s rows/s)", formatBytes(float64(bytes)/secs), formatCount(float64(rows)/secs))
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	pg "gopkg.in/pg.v4"
+)
+
+const (
+	BEGIN_TABLE_SCHEMA = `
+--
+-- Name: %s; Type: TABLE
+--
+
+`
+
+	CREATE_TABLE = "CREATE TABLE IF NOT EXISTS %s (\n    %s\n);\n"
+)
+
+type ColumnDefinition struct {
+	Colname string
+	Typedef string
+	Notnull bool
+}
+
+func getTableColDefs(db *pg.DB, table string) (map[string]ColumnDefinition, error) {
+	var model []ColumnDefinition
+	sql := `
+		SELECT
+			attname AS colname,
+			format_type(atttypid, atttypmod) AS typedef,
+			attnotnull AS notnull
+		FROM pg_catalog.pg_attribute
+		WHERE
+			attrelid = ?::regclass
+			AND attnum > 0
+			AND attisdropped = FALSE
+	`
+	_, err := db.Query(&model, sql, quoteTable(table))
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make(map[string]ColumnDefinition)
+	for _, v := range model {
+		defs[v.Colname] = v
+	}
+	return defs, nil
+}
+
+// dumpTableSchema dumps the CREATE TABLE statement of the target table with
+// the dumped columns of the table, their types, NOT NULL constraints and the
+// primary key if all its columns are dumped. The defaults, indexes and other
+// constraints are not dumped.
+func dumpTableSchema(w io.Writer, db *pg.DB, table string, target string, cols []string) error {
+	defs, err := getTableColDefs(db, table)
+	if err != nil {
+		return err
+	}
+	pk, err := getTablePrimaryKey(db, table)
+	if err != nil {
+		return err
+	}
+
+	lines := make([]string, 0)
+	for _, col := range cols {
+		def, ok := defs[col]
+		if !ok {
+			return fmt.Errorf("table %s: column %s not found", table, col)
+		}
+		line := fmt.Sprintf("%s %s", quoteIdent(col), def.Typedef)
+		if def.Notnull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+
+	hasPk := len(pk) > 0
+	for _, col := range pk {
+		if !contains(cols, col) {
+			hasPk = false
+		}
+	}
+	if hasPk {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s)", quoteColumns(pk)))
+	}
+
+	fmt.Fprintf(w, BEGIN_TABLE_SCHEMA, commentText(target))
+	fmt.Fprintf(w, CREATE_TABLE, quoteTable(target), strings.Join(lines, ",\n    "))
+	return nil
+}
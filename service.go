@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// serviceFiles returns the paths to the connection service files in the
+// order they are searched: either $PGSERVICEFILE or ~/.pg_service.conf, then
+// pg_service.conf in $PGSYSCONFDIR or /etc.
+func serviceFiles() []string {
+	paths := make([]string, 0)
+	if path := os.Getenv("PGSERVICEFILE"); path != "" {
+		paths = append(paths, path)
+	} else if currentUser, err := user.Current(); err == nil {
+		paths = append(paths, filepath.Join(currentUser.HomeDir, ".pg_service.conf"))
+	}
+	sysconfdir := os.Getenv("PGSYSCONFDIR")
+	if sysconfdir == "" {
+		sysconfdir = "/etc"
+	}
+	return append(paths, filepath.Join(sysconfdir, "pg_service.conf"))
+}
+
+// readService returns the parameters of the service from the service file, or
+// nil if the file doesn't define the service. The parameters which aren't
+// connection parameters of the dump are ignored.
+func readService(path string, name string) (*connParams, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var params *connParams
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if params != nil {
+				// The service is complete
+				break
+			}
+			if line[1:len(line)-1] == name {
+				params = &connParams{}
+			}
+			continue
+		}
+		if params == nil {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s:%d: syntax error in service file", path, n)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "host":
+			params.Host = value
+		case "port":
+			params.Port, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid port %s", path, n, value)
+			}
+		case "user":
+			params.User = value
+		case "password":
+			params.Password = value
+		case "dbname":
+			params.Database = value
+		case "sslmode":
+			params.SSLMode = value
+		case "sslrootcert":
+			params.SSLRootCert = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// lookupService returns the parameters of the connection service, the same
+// way as libpq does: the service is looked up in the user's service file
+// first, then in the system-wide one.
+func lookupService(name string) (*connParams, error) {
+	found := false
+	for _, path := range serviceFiles() {
+		params, err := readService(path, name)
+		if os.IsNotExist(err) {
+			// $PGSERVICEFILE must exist if it is set
+			if path == os.Getenv("PGSERVICEFILE") {
+				return nil, fmt.Errorf("service file %s not found", path)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		found = true
+		if params != nil {
+			return params, nil
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("service file not found, looked for %s", strings.Join(serviceFiles(), " and "))
+	}
+	return nil, fmt.Errorf("definition of service %s not found", name)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	pg "gopkg.in/pg.v4"
+	"gopkg.in/pg.v4/orm"
+)
+
+// exportSnapshot begins the transaction of the consistent dump with the
+// isolation level, either "repeatable-read" or "serializable", and exports
+// its snapshot. The serializable transaction is deferrable, so it waits for a
+// snapshot free of serialization anomalies before the snapshot is exported.
+// The snapshot can be imported as long as the transaction is open.
+func exportSnapshot(db *pg.DB, isolation string) (*pg.Tx, string, error) {
+	level := "REPEATABLE READ, READ ONLY"
+	if isolation == "serializable" {
+		level = "SERIALIZABLE, READ ONLY, DEFERRABLE"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = tx.Exec("SET TRANSACTION ISOLATION LEVEL " + level)
+	if err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+	var snapshot string
+	_, err = tx.QueryOne(pg.Scan(&snapshot), "SELECT pg_export_snapshot()")
+	if err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("cannot export the snapshot of the consistent dump: %v", err)
+	}
+	return tx, snapshot, nil
+}
+
+// setSnapshot makes the transaction see the same data as the transaction of
+// the consistent dump, if any. It must be called before any other query of
+// the transaction. The snapshot is imported in a repeatable read transaction
+// in either case, the snapshot of a serializable deferrable transaction is
+// safe already.
+func setSnapshot(db orm.DB, opts *Options) error {
+	if opts.Snapshot == "" {
+		return nil
+	}
+	_, err := db.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("SET TRANSACTION SNAPSHOT ?", opts.Snapshot)
+	return err
+}
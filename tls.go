@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// makeTLSConfig returns the TLS configuration for the libpq-style sslmode, or
+// nil if TLS should not be used.
+func makeTLSConfig(sslmode string, rootcert string, host string) (*tls.Config, error) {
+	switch sslmode {
+	case "disable", "allow":
+		return nil, nil
+	case "prefer":
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	case "require":
+		if rootcert == "" {
+			return &tls.Config{InsecureSkipVerify: true}, nil
+		}
+		// Same as libpq, verify the server certificate if the root
+		// certificate is available
+		return makeTLSConfig("verify-ca", rootcert, host)
+	case "verify-ca", "verify-full":
+	default:
+		return nil, fmt.Errorf("invalid sslmode %s", sslmode)
+	}
+
+	config := &tls.Config{}
+	if rootcert != "" {
+		pem, err := ioutil.ReadFile(rootcert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", rootcert)
+		}
+	}
+
+	if sslmode == "verify-full" {
+		config.ServerName = host
+		return config, nil
+	}
+
+	// verify-ca checks the certificate chain only, not the host name
+	config.InsecureSkipVerify = true
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		certs := make([]*x509.Certificate, 0)
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) == 0 {
+			return fmt.Errorf("server did not provide a certificate")
+		}
+
+		verifyOpts := x509.VerifyOptions{
+			Roots:         config.RootCAs,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			verifyOpts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(verifyOpts)
+		return err
+	}
+
+	return config, nil
+}
+
+// isSSLNotSupported returns true if the server refused the TLS connection.
+func isSSLNotSupported(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "SSL is not enabled on the server")
+}
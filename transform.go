@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Transformer transforms the values of a column in the insert format, e.g. to
+// replace them with fake data. The value is the text representation of the
+// value, nil for NULL, and it is valid during the call only. The transformers
+// are called concurrently when dumping the tables in parallel.
+type Transformer interface {
+	Transform(table, column string, value []byte) ([]byte, error)
+}
+
+// TransformerFunc is a function used as a Transformer.
+type TransformerFunc func(table, column string, value []byte) ([]byte, error)
+
+func (f TransformerFunc) Transform(table, column string, value []byte) ([]byte, error) {
+	return f(table, column, value)
+}
+
+// transformers are the transformers available in the `transform` of the
+// manifest tables by name.
+var transformers = map[string]Transformer{
+	"faker-name":  TransformerFunc(fakeName),
+	"faker-email": TransformerFunc(fakeEmail),
+}
+
+// RegisterTransformer makes the transformer available in the `transform` of the
+// manifest tables under the name, replacing the transformer of the same name.
+// The transformers must be registered before the manifest is read.
+func RegisterTransformer(name string, t Transformer) {
+	transformers[name] = t
+}
+
+var fakeFirstNames = []string{
+	"Alice", "Bob", "Carol", "David", "Emma", "Frank", "Grace", "Henry",
+	"Isabel", "Jack", "Karen", "Liam", "Maria", "Noah", "Olivia", "Peter",
+	"Quinn", "Rachel", "Samuel", "Tina", "Victor", "Wendy", "Xavier", "Yvonne",
+}
+
+var fakeLastNames = []string{
+	"Anderson", "Brown", "Clark", "Davis", "Evans", "Fischer", "Garcia",
+	"Harris", "Jackson", "Johnson", "King", "Lewis", "Martin", "Miller",
+	"Moore", "Nelson", "Parker", "Roberts", "Smith", "Taylor", "Thomas",
+	"Walker", "White", "Wilson",
+}
+
+// fakePerson returns the fake first and last name for the value. The same
+// value always gets the same name, so that the names stay consistent across
+// the tables and dumps.
+func fakePerson(value []byte) (string, string, uint64) {
+	h := fnv.New64a()
+	h.Write(value)
+	sum := h.Sum64()
+	first := fakeFirstNames[sum%uint64(len(fakeFirstNames))]
+	last := fakeLastNames[(sum/uint64(len(fakeFirstNames)))%uint64(len(fakeLastNames))]
+	return first, last, sum
+}
+
+func fakeName(_, _ string, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	first, last, _ := fakePerson(value)
+	return []byte(first + " " + last), nil
+}
+
+func fakeEmail(_, _ string, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	// The number keeps the addresses of the different values unique enough
+	// for the unique constraints
+	first, last, sum := fakePerson(value)
+	return []byte(fmt.Sprintf("%s.%s.%d@example.com", strings.ToLower(first), strings.ToLower(last), sum%100000)), nil
+}
+
+// validateTransform checks that the transformers of the table exist.
+func validateTransform(v *ManifestItem) error {
+	cols := make([]string, 0)
+	for col := range v.Transform {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	for _, col := range cols {
+		if _, ok := transformers[v.Transform[col]]; !ok {
+			return fmt.Errorf("table %s: unknown transformer %s of column %s", v.Table, v.Transform[col], col)
+		}
+	}
+	return nil
+}
+
+// columnTransforms returns the transform functions of the dumped columns of
+// the table, nil for the columns which are not transformed, or nil if no column
+// is transformed.
+func columnTransforms(v *ManifestItem, cols []string) ([]func([]byte) ([]byte, error), error) {
+	if len(v.Transform) == 0 {
+		return nil, nil
+	}
+	for col := range v.Transform {
+		if !contains(cols, col) {
+			return nil, fmt.Errorf("table %s: transformed column %s is not dumped", v.Table, col)
+		}
+	}
+
+	transforms := make([]func([]byte) ([]byte, error), len(cols))
+	for i, col := range cols {
+		name, ok := v.Transform[col]
+		if !ok {
+			continue
+		}
+		t := transformers[name]
+		table, column := v.Table, col
+		transforms[i] = func(value []byte) ([]byte, error) {
+			return t.Transform(table, column, value)
+		}
+	}
+	return transforms, nil
+}